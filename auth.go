@@ -0,0 +1,166 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// Account — зарегистрированный пользователь сервиса: логин, хэш пароля и
+// признак администратора. Не путать с User, который описывает чек-ин
+// в конкретной комнате.
+type Account struct {
+    Name         string `json:"name"`
+    PasswordHash string `json:"-"`
+    Admin        bool   `json:"admin"`
+}
+
+// accountRegistry хранит зарегистрированные аккаунты в памяти, по аналогии
+// с ConferenceAPI.Rooms.
+var accountRegistry = struct {
+    sync.RWMutex
+    byName map[string]*Account
+}{byName: make(map[string]*Account)}
+
+// jwtSecret подписывает выданные токены. Задаётся флагом --jwt-secret в
+// main (по аналогии с --cluster-secret); значение по умолчанию годится
+// только для локальной разработки.
+var jwtSecret = []byte("change-me-in-production")
+
+// SetJWTSecret переопределяет jwtSecret. Вызывается из main после разбора
+// флагов, если задан --jwt-secret.
+func SetJWTSecret(secret string) {
+    jwtSecret = []byte(secret)
+}
+
+type authClaims struct {
+    Name  string `json:"name"`
+    Admin bool   `json:"admin"`
+    jwt.RegisteredClaims
+}
+
+// registerHandler обрабатывает POST /register: создаёт обычный (не admin)
+// аккаунт с bcrypt-хэшем пароля. Права администратора через этот endpoint не
+// выдаются — это предотвращает самоназначение admin и обход host-only
+// проверки в closeRoomHandler. Повышение до admin — отдельная внутренняя
+// операция, а не поле запроса.
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Name     string `json:"name"`
+        Password string `json:"password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Неверный формат запроса", http.StatusBadRequest)
+        return
+    }
+    if req.Name == "" || req.Password == "" {
+        http.Error(w, "Поля name и password обязательны", http.StatusBadRequest)
+        return
+    }
+
+    hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+    if err != nil {
+        http.Error(w, "Не удалось обработать пароль", http.StatusInternalServerError)
+        return
+    }
+
+    accountRegistry.Lock()
+    defer accountRegistry.Unlock()
+    if _, exists := accountRegistry.byName[req.Name]; exists {
+        http.Error(w, "Пользователь с таким именем уже существует", http.StatusConflict)
+        return
+    }
+    accountRegistry.byName[req.Name] = &Account{Name: req.Name, PasswordHash: string(hash)}
+
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(map[string]string{"status": "registered"})
+}
+
+// loginHandler обрабатывает POST /login: проверяет пароль и выдаёт
+// подписанный JWT сроком на 24 часа.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        Name     string `json:"name"`
+        Password string `json:"password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Неверный формат запроса", http.StatusBadRequest)
+        return
+    }
+
+    accountRegistry.RLock()
+    account, exists := accountRegistry.byName[req.Name]
+    accountRegistry.RUnlock()
+    if !exists || bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(req.Password)) != nil {
+        http.Error(w, "Неверное имя пользователя или пароль", http.StatusUnauthorized)
+        return
+    }
+
+    now := time.Now()
+    claims := authClaims{
+        Name:  account.Name,
+        Admin: account.Admin,
+        RegisteredClaims: jwt.RegisteredClaims{
+            IssuedAt:  jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+        },
+    }
+
+    token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+    if err != nil {
+        http.Error(w, "Не удалось подписать токен", http.StatusInternalServerError)
+        return
+    }
+
+    json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+type contextKey string
+
+const accountContextKey contextKey = "account"
+
+// requireAuth — middleware, проверяющее Bearer-токен и инжектящее вызывающий
+// Account в контекст запроса перед вызовом next.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        account, err := authenticate(r)
+        if err != nil {
+            http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+            return
+        }
+        ctx := context.WithValue(r.Context(), accountContextKey, account)
+        next(w, r.WithContext(ctx))
+    }
+}
+
+// authenticate разбирает и проверяет заголовок Authorization: Bearer <token>.
+func authenticate(r *http.Request) (*Account, error) {
+    header := r.Header.Get("Authorization")
+    tokenString := strings.TrimPrefix(header, "Bearer ")
+    if tokenString == "" || tokenString == header {
+        return nil, errors.New("отсутствует bearer-токен")
+    }
+
+    var claims authClaims
+    _, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+        return jwtSecret, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return &Account{Name: claims.Name, Admin: claims.Admin}, nil
+}
+
+// accountFromContext достаёт Account, положенный requireAuth.
+func accountFromContext(r *http.Request) *Account {
+    account, _ := r.Context().Value(accountContextKey).(*Account)
+    return account
+}
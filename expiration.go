@@ -0,0 +1,229 @@
+package main
+
+import (
+    "container/heap"
+    "fmt"
+    "log"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// expirationEntry — запись в очереди истечения: когда (userID, roomID)
+// должен быть выселен, и с каким поколением он был запланирован.
+type expirationEntry struct {
+    expiresAt  time.Time
+    roomID     string
+    userID     string
+    generation uint64
+    index      int // поддерживается container/heap, не трогать руками.
+}
+
+// expirationHeap — мин-куча по expiresAt.
+type expirationHeap []*expirationEntry
+
+func (h expirationHeap) Len() int            { return len(h) }
+func (h expirationHeap) Less(i, j int) bool  { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expirationHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i]; h[i].index = i; h[j].index = j }
+func (h *expirationHeap) Push(x interface{}) {
+    entry := x.(*expirationEntry)
+    entry.index = len(*h)
+    *h = append(*h, entry)
+}
+func (h *expirationHeap) Pop() interface{} {
+    old := *h
+    n := len(old)
+    entry := old[n-1]
+    old[n-1] = nil
+    *h = old[:n-1]
+    return entry
+}
+
+// expirationManager централизованно отслеживает дедлайны присутствия всех
+// пользователей во всех комнатах через одну мин-кучу вместо попутной чистки
+// в listRoomsHandler. Обновление дедлайна пользователя не трогает старую
+// запись в куче — вместо этого растёт generation, и устаревшая запись
+// отбрасывается лениво при извлечении (избегаем O(log n) heap.Fix с внешними
+// индексами).
+type expirationManager struct {
+    mu          sync.Mutex
+    queue       expirationHeap
+    generations map[string]uint64
+    timer       *time.Timer
+
+    expirationsTotal uint64 // атомарный счётчик для /metrics.
+}
+
+var expManager = newExpirationManager()
+
+func newExpirationManager() *expirationManager {
+    m := &expirationManager{
+        generations: make(map[string]uint64),
+        timer:       time.NewTimer(time.Hour),
+    }
+    heap.Init(&m.queue)
+    m.timer.Stop()
+    go m.run()
+    return m
+}
+
+func generationKey(roomID, userID string) string {
+    return roomID + "/" + userID
+}
+
+// Schedule ставит (обновляет) дедлайн пользователя в комнате. Вызывается из
+// checkInHandler и updatePresenceHandler.
+func (m *expirationManager) Schedule(roomID, userID string, expiresAt time.Time) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    key := generationKey(roomID, userID)
+    m.generations[key]++
+    heap.Push(&m.queue, &expirationEntry{
+        expiresAt:  expiresAt,
+        roomID:     roomID,
+        userID:     userID,
+        generation: m.generations[key],
+    })
+    m.resetTimerLocked()
+}
+
+// QueueDepth возвращает текущий размер кучи (включая ещё не отброшенные
+// устаревшие записи) для метрики очереди.
+func (m *expirationManager) QueueDepth() int {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return len(m.queue)
+}
+
+// ExpirationsTotal возвращает общее число выселений с момента старта.
+func (m *expirationManager) ExpirationsTotal() uint64 {
+    return atomic.LoadUint64(&m.expirationsTotal)
+}
+
+func (m *expirationManager) resetTimerLocked() {
+    if !m.timer.Stop() {
+        select {
+        case <-m.timer.C:
+        default:
+        }
+    }
+    if len(m.queue) == 0 {
+        return
+    }
+    delay := time.Until(m.queue[0].expiresAt)
+    if delay < 0 {
+        delay = 0
+    }
+    m.timer.Reset(delay)
+}
+
+func (m *expirationManager) run() {
+    for range m.timer.C {
+        m.evictDue()
+    }
+}
+
+// evictDue выселяет из кучи все записи с истёкшим дедлайном, отбрасывая по
+// пути устаревшие (superseded) записи, и взводит таймер на следующий дедлайн.
+func (m *expirationManager) evictDue() {
+    now := time.Now()
+
+    var due []*expirationEntry
+    m.mu.Lock()
+    for len(m.queue) > 0 && !m.queue[0].expiresAt.After(now) {
+        entry := heap.Pop(&m.queue).(*expirationEntry)
+        if m.generations[generationKey(entry.roomID, entry.userID)] != entry.generation {
+            continue // устарела: пользователь с тех пор продлил присутствие.
+        }
+        due = append(due, entry)
+    }
+    m.resetTimerLocked()
+    m.mu.Unlock()
+
+    for _, entry := range due {
+        atomic.AddUint64(&m.expirationsTotal, 1)
+        evictUser(entry.roomID, entry.userID)
+    }
+}
+
+// evictUser удаляет пользователя из комнаты (в памяти и в хранилище) и
+// публикует событие user_left.
+func evictUser(roomID, userID string) {
+    api.RoomLock.RLock()
+    room, exists := api.Rooms[roomID]
+    api.RoomLock.RUnlock()
+    if !exists {
+        return
+    }
+
+    room.UserLock.Lock()
+    user, exists := room.Users[userID]
+    if exists {
+        delete(room.Users, userID)
+    }
+    room.UserLock.Unlock()
+    if !exists {
+        return
+    }
+
+    if store != nil {
+        if err := store.DeleteExpiredUsers(time.Now()); err != nil {
+            log.Printf("не удалось удалить истёкшего пользователя %s в хранилище: %v", userID, err)
+        }
+    }
+
+    if cluster != nil && cluster.IsLocal(roomID) {
+        cluster.gossipReplicate(replicationPayload{Op: replicateDelete, RoomID: roomID, UserID: userID})
+    }
+
+    room.Hub.Publish(Event{Type: EventUserLeft, RoomID: roomID, Payload: user})
+}
+
+// deadlineTimer — таймер, который можно детерминированно переустанавливать
+// или отменять, по образцу deadlineTimer из netstack: отмена старого таймера
+// идёт через закрытие cancel-канала, а не через флаги гонки.
+type deadlineTimer struct {
+    mu     sync.Mutex
+    timer  *time.Timer
+    cancel chan struct{}
+}
+
+// SetDeadline переустанавливает дедлайн комнаты на t и вызывает afterDeadline
+// по его достижении, если до этого дедлайн не был переустановлен повторно.
+// Используется в тестах для детерминированного управления временем вместо
+// реального ожидания.
+func (room *Room) SetDeadline(t time.Time, afterDeadline func()) {
+    room.deadline.mu.Lock()
+    defer room.deadline.mu.Unlock()
+
+    if room.deadline.cancel != nil {
+        close(room.deadline.cancel)
+    }
+    cancel := make(chan struct{})
+    room.deadline.cancel = cancel
+
+    if room.deadline.timer != nil {
+        room.deadline.timer.Stop()
+    }
+    room.deadline.timer = time.AfterFunc(time.Until(t), func() {
+        select {
+        case <-cancel:
+            return
+        default:
+        }
+        afterDeadline()
+    })
+}
+
+// metricsHandler отдаёт текущую глубину очереди истечения и число выселений
+// в простом формате, совместимом с Prometheus text exposition format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+    fmt.Fprintf(w, "# HELP gotest_expiration_queue_depth Текущий размер очереди истечения присутствия.\n")
+    fmt.Fprintf(w, "# TYPE gotest_expiration_queue_depth gauge\n")
+    fmt.Fprintf(w, "gotest_expiration_queue_depth %d\n", expManager.QueueDepth())
+    fmt.Fprintf(w, "# HELP gotest_expirations_total Общее число выселений пользователей по дедлайну.\n")
+    fmt.Fprintf(w, "# TYPE gotest_expirations_total counter\n")
+    fmt.Fprintf(w, "gotest_expirations_total %d\n", expManager.ExpirationsTotal())
+}
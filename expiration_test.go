@@ -0,0 +1,54 @@
+package main
+
+import (
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// TestRoomSetDeadlineFires проверяет, что SetDeadline вызывает afterDeadline
+// по достижении дедлайна.
+func TestRoomSetDeadlineFires(t *testing.T) {
+    room := &Room{}
+    fired := make(chan struct{})
+
+    room.SetDeadline(time.Now().Add(10*time.Millisecond), func() {
+        close(fired)
+    })
+
+    select {
+    case <-fired:
+    case <-time.After(time.Second):
+        t.Fatal("afterDeadline не был вызван по истечении дедлайна")
+    }
+}
+
+// TestRoomSetDeadlineResetCancelsPrevious проверяет, что повторный вызов
+// SetDeadline отменяет ещё не сработавший предыдущий дедлайн — именно это
+// отмена через cancel-канал и должна гарантировать.
+func TestRoomSetDeadlineResetCancelsPrevious(t *testing.T) {
+    room := &Room{}
+    var calls int32
+
+    room.SetDeadline(time.Now().Add(10*time.Millisecond), func() {
+        atomic.AddInt32(&calls, 1)
+    })
+
+    done := make(chan struct{})
+    room.SetDeadline(time.Now().Add(20*time.Millisecond), func() {
+        atomic.AddInt32(&calls, 1)
+        close(done)
+    })
+
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("второй дедлайн не сработал")
+    }
+
+    // Даём отменённому первому таймеру шанс выстрелить, если отмена не сработала.
+    time.Sleep(50 * time.Millisecond)
+    if got := atomic.LoadInt32(&calls); got != 1 {
+        t.Fatalf("ожидался 1 вызов afterDeadline после переустановки, получено %d", got)
+    }
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "log"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+)
+
+// clusterConfig описывает узел федерации GoTest: его ID, адреса пиров и
+// общий секрет для подписи внутренней репликации.
+type clusterConfig struct {
+    NodeID string
+    Peers  map[string]string // nodeID -> базовый URL пира.
+    Secret []byte
+    ring   *hashRing
+}
+
+// cluster == nil означает, что узел работает автономно (не в федерации).
+var cluster *clusterConfig
+
+// InitCluster настраивает федерацию по NodeID текущего узла и списку пиров
+// вида "id=http://host:port". Вызывается из main, если заданы флаги
+// --node-id/--peers.
+func InitCluster(nodeID string, peerSpecs []string, secret string) error {
+    peers := make(map[string]string)
+    for _, spec := range peerSpecs {
+        parts := strings.SplitN(spec, "=", 2)
+        if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+            return fmt.Errorf("неверный формат пира %q, ожидается id=url", spec)
+        }
+        peers[parts[0]] = parts[1]
+    }
+
+    members := make([]string, 0, len(peers)+1)
+    members = append(members, nodeID)
+    for id := range peers {
+        members = append(members, id)
+    }
+
+    cluster = &clusterConfig{
+        NodeID: nodeID,
+        Peers:  peers,
+        Secret: []byte(secret),
+        ring:   newHashRing(members, 100),
+    }
+    return nil
+}
+
+// hashRing — консистентное хеширование room_id на владеющий узел кластера,
+// со 100 виртуальными репликами на узел для равномерного распределения.
+type hashRing struct {
+    replicas     int
+    sortedHashes []uint32
+    hashToNode   map[uint32]string
+}
+
+func newHashRing(nodeIDs []string, replicas int) *hashRing {
+    r := &hashRing{replicas: replicas, hashToNode: make(map[uint32]string)}
+    for _, node := range nodeIDs {
+        for i := 0; i < replicas; i++ {
+            h := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", node, i)))
+            r.hashToNode[h] = node
+            r.sortedHashes = append(r.sortedHashes, h)
+        }
+    }
+    sort.Slice(r.sortedHashes, func(i, j int) bool { return r.sortedHashes[i] < r.sortedHashes[j] })
+    return r
+}
+
+// Owner возвращает NodeID узла, ответственного за ключ (room_id).
+func (r *hashRing) Owner(key string) string {
+    h := crc32.ChecksumIEEE([]byte(key))
+    idx := sort.Search(len(r.sortedHashes), func(i int) bool { return r.sortedHashes[i] >= h })
+    if idx == len(r.sortedHashes) {
+        idx = 0
+    }
+    return r.hashToNode[r.sortedHashes[idx]]
+}
+
+// Owner — удобный метод clusterConfig, вызывающий ring.Owner.
+func (c *clusterConfig) Owner(roomID string) string {
+    return c.ring.Owner(roomID)
+}
+
+// IsLocal сообщает, является ли текущий узел владельцем room_id.
+func (c *clusterConfig) IsLocal(roomID string) bool {
+    return c.Owner(roomID) == c.NodeID
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+// doWithBackoff выполняет HTTP-запрос с экспоненциальным бэкоффом (до 3
+// попыток), начиная со 100мс. Используется и для форвардинга на владельца,
+// и для гоcсипа репликации.
+func doWithBackoff(req *http.Request, body []byte) (*http.Response, error) {
+    const maxAttempts = 3
+    delay := 100 * time.Millisecond
+
+    var lastErr error
+    for attempt := 0; attempt < maxAttempts; attempt++ {
+        if body != nil {
+            req.Body = io.NopCloser(bytes.NewReader(body))
+        }
+        resp, err := httpClient.Do(req)
+        if err == nil {
+            return resp, nil
+        }
+        lastErr = err
+        if attempt < maxAttempts-1 {
+            time.Sleep(delay)
+            delay *= 2
+        }
+    }
+    return nil, lastErr
+}
+
+// forwardToOwner перенаправляет запрос на узел-владелец комнаты и
+// ретранслирует его ответ вызывающей стороне без изменений.
+func forwardToOwner(w http.ResponseWriter, r *http.Request, ownerID string, body []byte) {
+    baseURL, ok := cluster.Peers[ownerID]
+    if !ok {
+        http.Error(w, "Узел-владелец комнаты недостижим", http.StatusBadGateway)
+        return
+    }
+
+    targetURL := baseURL + r.URL.Path
+    if r.URL.RawQuery != "" {
+        targetURL += "?" + r.URL.RawQuery
+    }
+
+    req, err := http.NewRequest(r.Method, targetURL, bytes.NewReader(body))
+    if err != nil {
+        http.Error(w, "Не удалось сформировать запрос к владельцу комнаты", http.StatusInternalServerError)
+        return
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := doWithBackoff(req, body)
+    if err != nil {
+        http.Error(w, "Узел-владелец комнаты не отвечает", http.StatusBadGateway)
+        return
+    }
+    defer resp.Body.Close()
+
+    w.WriteHeader(resp.StatusCode)
+    io.Copy(w, resp.Body)
+}
+
+// replicationOp — тип операции в сообщении репликации.
+type replicationOp string
+
+const (
+    replicateUpsert replicationOp = "upsert"
+    replicateDelete replicationOp = "delete"
+)
+
+// replicationPayload — то, что рассылается узлом-владельцем остальным узлам
+// кластера через POST /internal/replicate.
+type replicationPayload struct {
+    Op        replicationOp `json:"op"`
+    RoomID    string        `json:"room_id"`
+    UserID    string        `json:"user_id"`
+    ExpiresAt time.Time     `json:"expires_at,omitempty"`
+}
+
+// signPayload подписывает тело сообщения репликации HMAC-SHA256 общим
+// секретом кластера.
+func signPayload(body []byte) string {
+    mac := hmac.New(sha256.New, cluster.Secret)
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// gossipReplicate рассылает изменение присутствия всем пирам кластера.
+// Вызывается только узлом-владельцем комнаты; пиры применяют изменение
+// локально и дальше не ретранслируют (не гоняем сообщения по кругу).
+func (c *clusterConfig) gossipReplicate(payload replicationPayload) {
+    body, err := json.Marshal(payload)
+    if err != nil {
+        log.Printf("не удалось сериализовать сообщение репликации: %v", err)
+        return
+    }
+    signature := signPayload(body)
+
+    for peerID, baseURL := range c.Peers {
+        go func(peerID, baseURL string) {
+            req, err := http.NewRequest(http.MethodPost, baseURL+"/internal/replicate", bytes.NewReader(body))
+            if err != nil {
+                log.Printf("не удалось собрать запрос репликации к %s: %v", peerID, err)
+                return
+            }
+            req.Header.Set("Content-Type", "application/json")
+            req.Header.Set("X-Cluster-Signature", signature)
+
+            resp, err := doWithBackoff(req, body)
+            if err != nil {
+                log.Printf("репликация к узлу %s не удалась: %v", peerID, err)
+                return
+            }
+            resp.Body.Close()
+        }(peerID, baseURL)
+    }
+}
+
+// replicateHandler обрабатывает входящие POST /internal/replicate от других
+// узлов кластера: проверяет HMAC-подпись и применяет изменение локально.
+func replicateHandler(w http.ResponseWriter, r *http.Request) {
+    if cluster == nil {
+        http.Error(w, "Узел не состоит в кластере", http.StatusNotFound)
+        return
+    }
+
+    body, err := io.ReadAll(r.Body)
+    if err != nil {
+        http.Error(w, "Не удалось прочитать тело запроса", http.StatusBadRequest)
+        return
+    }
+
+    signature := r.Header.Get("X-Cluster-Signature")
+    if !hmac.Equal([]byte(signature), []byte(signPayload(body))) {
+        http.Error(w, "Неверная подпись", http.StatusUnauthorized)
+        return
+    }
+
+    var payload replicationPayload
+    if err := json.Unmarshal(body, &payload); err != nil {
+        http.Error(w, "Неверный формат сообщения репликации", http.StatusBadRequest)
+        return
+    }
+
+    switch payload.Op {
+    case replicateUpsert:
+        applyReplicatedUpsert(payload.RoomID, payload.UserID, payload.ExpiresAt)
+    case replicateDelete:
+        evictUser(payload.RoomID, payload.UserID)
+    default:
+        http.Error(w, "Неизвестная операция репликации", http.StatusBadRequest)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+}
+
+// applyReplicatedUpsert локально применяет присутствие, принятое от
+// узла-владельца, создавая комнату при необходимости.
+func applyReplicatedUpsert(roomID, userID string, expiresAt time.Time) {
+    api.RoomLock.Lock()
+    room, exists := api.Rooms[roomID]
+    if !exists {
+        room = &Room{Name: roomID, Users: make(map[string]User), Hub: NewHub(), CreatedAt: time.Now()}
+        api.Rooms[roomID] = room
+    }
+    api.RoomLock.Unlock()
+
+    user := User{ID: userID, ExpiresAt: expiresAt}
+    room.UserLock.Lock()
+    room.Users[userID] = user
+    room.UserLock.Unlock()
+
+    room.Hub.Publish(Event{Type: EventUserJoined, RoomID: roomID, Payload: user})
+}
+
+// healthHandler обрабатывает GET /internal/health: дёшево подтверждает, что
+// узел жив и отвечает, для использования пирами и балансировщиком.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+    nodeID := "standalone"
+    if cluster != nil {
+        nodeID = cluster.NodeID
+    }
+    json.NewEncoder(w).Encode(map[string]string{"status": "ok", "node_id": nodeID})
+}
+
+// fetchClusterRooms агрегирует список комнат со всех пиров кластера (локальный
+// узел вызывающая сторона добавляет сама) для ?scope=cluster.
+func fetchClusterRooms() []json.RawMessage {
+    var all []json.RawMessage
+    for peerID, baseURL := range cluster.Peers {
+        req, err := http.NewRequest(http.MethodGet, baseURL+"/list_rooms?scope=node", nil)
+        if err != nil {
+            log.Printf("не удалось собрать запрос списка комнат к %s: %v", peerID, err)
+            continue
+        }
+        resp, err := doWithBackoff(req, nil)
+        if err != nil {
+            log.Printf("узел %s недоступен при агрегации списка комнат: %v", peerID, err)
+            continue
+        }
+        var rooms []json.RawMessage
+        if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+            log.Printf("не удалось разобрать ответ узла %s: %v", peerID, err)
+        } else {
+            all = append(all, rooms...)
+        }
+        resp.Body.Close()
+    }
+    return all
+}
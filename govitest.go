@@ -2,8 +2,11 @@ package main
 
 import (
     "encoding/json"
+    "flag"
     "fmt"
+    "log"
     "net/http"
+    "strings"
     "sync"
     "time"
 )
@@ -16,9 +19,16 @@ type User struct {
 
 // Room представляет конференц-комнату с пользователями.
 type Room struct {
-    Name     string          `json:"name"`
-    Users    map[string]User `json:"users"`
-    UserLock sync.RWMutex    // Мьютекс для защиты доступа к пользователям.
+    Name          string          `json:"name"`
+    Users         map[string]User `json:"users"`
+    UserLock      sync.RWMutex    `json:"-"` // Мьютекс для защиты доступа к пользователям.
+    Hub           *Hub            `json:"-"` // Рассылка событий комнаты её WebSocket-подписчикам.
+    Host          *Account        `json:"host,omitempty"`
+    LifecycleLock sync.RWMutex    `json:"-"` // Защищает CreatedAt/ScheduledAt/EndedAt.
+    CreatedAt     time.Time       `json:"created_at"`
+    ScheduledAt   time.Time       `json:"scheduled_at,omitempty"`
+    EndedAt       time.Time       `json:"ended_at,omitempty"`
+    deadline      deadlineTimer   `json:"-"` // Для детерминированного управления временем в тестах, см. SetDeadline.
 }
 
 // ConferenceAPI содержит все комнаты.
@@ -32,6 +42,10 @@ var api = ConferenceAPI{
     Rooms: make(map[string]*Room),
 }
 
+// store — бэкенд персистентности, через который проходят все чек-ины и обновления
+// присутствия. По умолчанию nil (работа в памяти, как раньше).
+var store Store
+
 // checkInHandler обрабатывает чек-ин пользователя в комнату.
 func checkInHandler(w http.ResponseWriter, r *http.Request) {
     type CheckInRequest struct {
@@ -52,6 +66,12 @@ func checkInHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if cluster != nil && !cluster.IsLocal(req.RoomID) {
+        body, _ := json.Marshal(req)
+        forwardToOwner(w, r, cluster.Owner(req.RoomID), body)
+        return
+    }
+
     expiresAt := time.Now().Add(5 * time.Minute)
 
     user := User{
@@ -65,15 +85,36 @@ func checkInHandler(w http.ResponseWriter, r *http.Request) {
         room = &Room{
             Name:  req.RoomID,
             Users: make(map[string]User),
+            Hub:   NewHub(),
         }
         api.Rooms[req.RoomID] = room
     }
     api.RoomLock.Unlock()
 
+    if !exists && store != nil {
+        if err := store.SaveRoom(room); err != nil {
+            log.Printf("не удалось сохранить комнату %s в хранилище: %v", req.RoomID, err)
+        }
+    }
+
+    room.Hub.Publish(Event{Type: EventUserJoined, RoomID: req.RoomID, Payload: user})
+
     room.UserLock.Lock()
     room.Users[req.UserID] = user
     room.UserLock.Unlock()
 
+    if store != nil {
+        if err := store.UpsertUser(req.RoomID, user); err != nil {
+            log.Printf("не удалось сохранить пользователя %s в хранилище: %v", req.UserID, err)
+        }
+    }
+
+    expManager.Schedule(req.RoomID, req.UserID, expiresAt)
+
+    if cluster != nil {
+        cluster.gossipReplicate(replicationPayload{Op: replicateUpsert, RoomID: req.RoomID, UserID: req.UserID, ExpiresAt: expiresAt})
+    }
+
     fmt.Fprintf(w, "Пользователь %s зачекинился в комнату %s\n", req.UserID, req.RoomID)
 }
 
@@ -98,6 +139,12 @@ func updatePresenceHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if cluster != nil && !cluster.IsLocal(req.RoomID) {
+        body, _ := json.Marshal(req)
+        forwardToOwner(w, r, cluster.Owner(req.RoomID), body)
+        return
+    }
+
     expiresAt := time.Now().Add(5 * time.Minute)
     if req.ExpiresIn > 0 {
         expiresAt = time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
@@ -123,6 +170,20 @@ func updatePresenceHandler(w http.ResponseWriter, r *http.Request) {
     room.Users[req.UserID] = user
     room.UserLock.Unlock()
 
+    if store != nil {
+        if err := store.UpsertUser(req.RoomID, user); err != nil {
+            log.Printf("не удалось обновить присутствие пользователя %s в хранилище: %v", req.UserID, err)
+        }
+    }
+
+    expManager.Schedule(req.RoomID, req.UserID, expiresAt)
+
+    if cluster != nil {
+        cluster.gossipReplicate(replicationPayload{Op: replicateUpsert, RoomID: req.RoomID, UserID: req.UserID, ExpiresAt: expiresAt})
+    }
+
+    room.Hub.Publish(Event{Type: EventPresenceExtended, RoomID: req.RoomID, Payload: user})
+
     fmt.Fprintf(w, "Присутствие пользователя %s в комнате %s обновлено\n", req.UserID, req.RoomID)
 }
 
@@ -135,18 +196,27 @@ func listRoomsHandler(w http.ResponseWriter, r *http.Request) {
 
     var roomsInfo []RoomInfo
 
+    includeClosed := r.URL.Query().Get("include_closed") == "true"
+
     api.RoomLock.RLock()
     for roomID, room := range api.Rooms {
-        room.UserLock.Lock()
+        room.LifecycleLock.RLock()
+        ended := !room.EndedAt.IsZero()
+        room.LifecycleLock.RUnlock()
+        if !includeClosed && ended {
+            continue
+        }
+
+        // Истечением присутствия занимается expirationManager (см. expiration.go);
+        // здесь мы только отфильтровываем то, что он ещё не успел выселить.
+        room.UserLock.RLock()
         var activeUsers []string
         for userID, user := range room.Users {
             if user.ExpiresAt.After(time.Now()) {
                 activeUsers = append(activeUsers, userID)
-            } else {
-                delete(room.Users, userID)
             }
         }
-        room.UserLock.Unlock()
+        room.UserLock.RUnlock()
 
         roomsInfo = append(roomsInfo, RoomInfo{
             RoomID:  roomID,
@@ -156,13 +226,101 @@ func listRoomsHandler(w http.ResponseWriter, r *http.Request) {
     api.RoomLock.RUnlock()
 
     w.Header().Set("Content-Type", "application/json")
+
+    if cluster != nil && r.URL.Query().Get("scope") == "cluster" {
+        local, err := json.Marshal(roomsInfo)
+        if err != nil {
+            http.Error(w, "Не удалось сериализовать список комнат", http.StatusInternalServerError)
+            return
+        }
+        var merged []json.RawMessage
+        if err := json.Unmarshal(local, &merged); err != nil {
+            http.Error(w, "Не удалось сериализовать список комнат", http.StatusInternalServerError)
+            return
+        }
+        merged = append(merged, fetchClusterRooms()...)
+        json.NewEncoder(w).Encode(merged)
+        return
+    }
+
     json.NewEncoder(w).Encode(roomsInfo)
 }
 
+// initStore открывает хранилище, выбранное флагом --store, и восстанавливает
+// в api.Rooms всё, что было сохранено до перезапуска.
+func initStore(kind, dsn string) error {
+    var err error
+    switch kind {
+    case "":
+        return nil
+    case "badger":
+        store, err = NewBadgerStore(dsn)
+    case "sqlite":
+        store, err = NewSQLStore(dsn)
+    default:
+        return fmt.Errorf("неизвестный тип хранилища: %s", kind)
+    }
+    if err != nil {
+        return err
+    }
+
+    rooms, err := store.LoadRooms()
+    if err != nil {
+        return fmt.Errorf("не удалось восстановить комнаты из хранилища: %w", err)
+    }
+    for _, room := range rooms {
+        room.Hub = NewHub()
+        for _, user := range room.Users {
+            expManager.Schedule(room.Name, user.ID, user.ExpiresAt)
+        }
+    }
+
+    api.RoomLock.Lock()
+    api.Rooms = rooms
+    api.RoomLock.Unlock()
+
+    log.Printf("восстановлено %d комнат из хранилища (%s)", len(rooms), kind)
+    return nil
+}
+
 func main() {
+    storeKind := flag.String("store", "", "бэкенд персистентности: badger или sqlite (по умолчанию — только в памяти)")
+    storeDSN := flag.String("store-dsn", "", "путь или DSN для выбранного хранилища")
+    nodeID := flag.String("node-id", "", "ID этого узла в кластере федерации (пусто — автономный режим)")
+    peers := flag.String("peers", "", "пиры кластера через запятую вида id=http://host:port")
+    clusterSecret := flag.String("cluster-secret", "", "общий секрет для подписи внутренней репликации")
+    jwtSecretFlag := flag.String("jwt-secret", "", "секрет для подписи JWT (по умолчанию — небезопасное значение для разработки)")
+    flag.Parse()
+
+    if *jwtSecretFlag != "" {
+        SetJWTSecret(*jwtSecretFlag)
+    }
+
+    if err := initStore(*storeKind, *storeDSN); err != nil {
+        log.Fatalf("ошибка инициализации хранилища: %v", err)
+    }
+
+    if *nodeID != "" {
+        var peerSpecs []string
+        if *peers != "" {
+            peerSpecs = strings.Split(*peers, ",")
+        }
+        if err := InitCluster(*nodeID, peerSpecs, *clusterSecret); err != nil {
+            log.Fatalf("ошибка инициализации кластера: %v", err)
+        }
+        log.Printf("узел %s запущен в кластере из %d пиров", *nodeID, len(peerSpecs))
+    }
+
     http.HandleFunc("/checkin", checkInHandler)
     http.HandleFunc("/update_presence", updatePresenceHandler)
     http.HandleFunc("/list_rooms", listRoomsHandler)
+    http.HandleFunc("/register", registerHandler)
+    http.HandleFunc("/login", loginHandler)
+    http.HandleFunc("/rooms", requireAuth(createRoomHandler))
+    http.HandleFunc("/rooms/", roomsPrefixHandler)
+    http.HandleFunc("/metrics", metricsHandler)
+    http.HandleFunc("/internal/replicate", replicateHandler)
+    http.HandleFunc("/internal/health", healthHandler)
 
     fmt.Println("Сервер запущен на порту 8080")
     if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -0,0 +1,218 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+
+    "github.com/gorilla/websocket"
+)
+
+// Событие, рассылаемое всем подписчикам комнаты в реальном времени.
+const (
+    EventUserJoined       = "user_joined"
+    EventUserLeft         = "user_left"
+    EventPresenceExtended = "presence_extended"
+    EventRoomClosed       = "room_closed"
+    EventChatMessage      = "chat_message"
+    EventBulletChat       = "bullet_chat"
+)
+
+// Event — сообщение, которое Hub рассылает подписчикам комнаты.
+type Event struct {
+    Type    string      `json:"type"`
+    RoomID  string      `json:"room_id"`
+    Payload interface{} `json:"payload,omitempty"`
+}
+
+// Hub хранит подписчиков одной комнаты и рассылает им события.
+type Hub struct {
+    mu          sync.RWMutex
+    subscribers map[chan Event]bool
+}
+
+// NewHub создаёт пустой хаб для комнаты.
+func NewHub() *Hub {
+    return &Hub{subscribers: make(map[chan Event]bool)}
+}
+
+// Subscribe регистрирует нового подписчика и возвращает канал, в который
+// будут приходить события комнаты.
+func (h *Hub) Subscribe() chan Event {
+    ch := make(chan Event, 16)
+    h.mu.Lock()
+    h.subscribers[ch] = true
+    h.mu.Unlock()
+    return ch
+}
+
+// Unsubscribe отписывает и закрывает канал подписчика.
+func (h *Hub) Unsubscribe(ch chan Event) {
+    h.mu.Lock()
+    if _, ok := h.subscribers[ch]; ok {
+        delete(h.subscribers, ch)
+        close(ch)
+    }
+    h.mu.Unlock()
+}
+
+// Publish рассылает событие всем текущим подписчикам. Медленные подписчики
+// с заполненным буфером пропускают событие, а не блокируют рассылку.
+func (h *Hub) Publish(event Event) {
+    h.mu.RLock()
+    defer h.mu.RUnlock()
+    for ch := range h.subscribers {
+        select {
+        case ch <- event:
+        default:
+            log.Printf("подписчик комнаты %s отстаёт, событие %s пропущено", event.RoomID, event.Type)
+        }
+    }
+}
+
+var wsUpgrader = websocket.Upgrader{
+    ReadBufferSize:  1024,
+    WriteBufferSize: 1024,
+    CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// chatMessage — полезная нагрузка для chat_message и bullet_chat.
+type chatMessage struct {
+    UserID  string `json:"user_id"`
+    Message string `json:"message"`
+}
+
+// roomWSHandler обрабатывает GET /rooms/{id}/ws: апгрейдит соединение до
+// WebSocket, подписывает его на Hub комнаты и ретранслирует входящие
+// chat/bullet_chat сообщения обратно в хаб.
+func roomWSHandler(w http.ResponseWriter, r *http.Request) {
+    roomID, rest, ok := parseRoomPath(r.URL.Path)
+    if !ok || rest != "ws" {
+        http.NotFound(w, r)
+        return
+    }
+
+    api.RoomLock.RLock()
+    room, exists := api.Rooms[roomID]
+    api.RoomLock.RUnlock()
+    if !exists {
+        http.Error(w, "Комната не найдена", http.StatusNotFound)
+        return
+    }
+
+    conn, err := wsUpgrader.Upgrade(w, r, nil)
+    if err != nil {
+        log.Printf("не удалось апгрейднуть соединение до WebSocket: %v", err)
+        return
+    }
+    defer conn.Close()
+
+    events := room.Hub.Subscribe()
+    defer room.Hub.Unsubscribe(events)
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for {
+            var inbound struct {
+                Type    string      `json:"type"`
+                Payload chatMessage `json:"payload"`
+            }
+            if err := conn.ReadJSON(&inbound); err != nil {
+                return
+            }
+            switch inbound.Type {
+            case EventChatMessage, EventBulletChat:
+                room.Hub.Publish(Event{Type: inbound.Type, RoomID: roomID, Payload: inbound.Payload})
+            }
+        }
+    }()
+
+    for {
+        select {
+        case <-done:
+            return
+        case event, ok := <-events:
+            if !ok {
+                return
+            }
+            if err := conn.WriteJSON(event); err != nil {
+                return
+            }
+        }
+    }
+}
+
+// roomChatHandler обрабатывает POST /rooms/{id}/chat: публикует обычное
+// чат-сообщение в хаб комнаты для всех её WebSocket-подписчиков.
+func roomChatHandler(w http.ResponseWriter, r *http.Request) {
+    roomID, rest, ok := parseRoomPath(r.URL.Path)
+    if !ok || rest != "chat" {
+        http.NotFound(w, r)
+        return
+    }
+
+    var msg chatMessage
+    if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+        http.Error(w, "Неверный формат запроса", http.StatusBadRequest)
+        return
+    }
+    if msg.UserID == "" || msg.Message == "" {
+        http.Error(w, "Поля user_id и message обязательны", http.StatusBadRequest)
+        return
+    }
+
+    api.RoomLock.RLock()
+    room, exists := api.Rooms[roomID]
+    api.RoomLock.RUnlock()
+    if !exists {
+        http.Error(w, "Комната не найдена", http.StatusNotFound)
+        return
+    }
+
+    room.Hub.Publish(Event{Type: EventChatMessage, RoomID: roomID, Payload: msg})
+    fmt.Fprintf(w, "Сообщение от %s отправлено в комнату %s\n", msg.UserID, roomID)
+}
+
+// roomsPrefixHandler диспетчеризует запросы под "/rooms/" по оставшемуся
+// сегменту пути ("ws" или "chat"). Остальные подпути под "/rooms/" будут
+// добавляться сюда по мере роста API.
+func roomsPrefixHandler(w http.ResponseWriter, r *http.Request) {
+    _, rest, ok := parseRoomPath(r.URL.Path)
+    if !ok {
+        http.NotFound(w, r)
+        return
+    }
+
+    switch rest {
+    case "ws":
+        roomWSHandler(w, r)
+    case "chat":
+        if r.Method != http.MethodPost {
+            http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+            return
+        }
+        roomChatHandler(w, r)
+    case "close":
+        requireAuth(closeRoomHandler)(w, r)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+// parseRoomPath разбирает путь вида "/rooms/{id}/{rest}" и возвращает id
+// комнаты и оставшийся сегмент.
+func parseRoomPath(path string) (roomID, rest string, ok bool) {
+    trimmed := strings.TrimPrefix(path, "/rooms/")
+    if trimmed == path {
+        return "", "", false
+    }
+    parts := strings.SplitN(trimmed, "/", 2)
+    if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+        return "", "", false
+    }
+    return parts[0], parts[1], true
+}
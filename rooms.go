@@ -0,0 +1,146 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "net/http"
+    "time"
+)
+
+// roomResponse — DTO для отдачи комнаты клиенту: в отличие от Room, не
+// содержит мьютексов и не показывает нулевые time.Time как настоящие значения
+// (omitempty не работает на time.Time, поэтому тут явные указатели).
+type roomResponse struct {
+    RoomID      string     `json:"room_id"`
+    Host        *Account   `json:"host,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+    EndedAt     *time.Time `json:"ended_at,omitempty"`
+}
+
+// newRoomResponse строит DTO комнаты, безопасно читая поля жизненного цикла
+// под LifecycleLock.
+func newRoomResponse(room *Room) roomResponse {
+    resp := roomResponse{RoomID: room.Name, Host: room.Host}
+
+    room.LifecycleLock.RLock()
+    defer room.LifecycleLock.RUnlock()
+
+    resp.CreatedAt = room.CreatedAt
+    if !room.ScheduledAt.IsZero() {
+        scheduledAt := room.ScheduledAt
+        resp.ScheduledAt = &scheduledAt
+    }
+    if !room.EndedAt.IsZero() {
+        endedAt := room.EndedAt
+        resp.EndedAt = &endedAt
+    }
+    return resp
+}
+
+// createRoomHandler обрабатывает POST /rooms: авторизованный пользователь
+// становится хостом новой комнаты, опционально планируя её на будущее.
+func createRoomHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+
+    host := accountFromContext(r)
+
+    var req struct {
+        RoomID      string     `json:"room_id"`
+        ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, "Неверный формат запроса", http.StatusBadRequest)
+        return
+    }
+    if req.RoomID == "" {
+        http.Error(w, "Поле room_id обязательно", http.StatusBadRequest)
+        return
+    }
+
+    room := &Room{
+        Name:      req.RoomID,
+        Users:     make(map[string]User),
+        Hub:       NewHub(),
+        Host:      host,
+        CreatedAt: time.Now(),
+    }
+    if req.ScheduledAt != nil {
+        room.ScheduledAt = *req.ScheduledAt
+    }
+
+    api.RoomLock.Lock()
+    if _, exists := api.Rooms[req.RoomID]; exists {
+        api.RoomLock.Unlock()
+        http.Error(w, "Комната с таким id уже существует", http.StatusConflict)
+        return
+    }
+    api.Rooms[req.RoomID] = room
+    api.RoomLock.Unlock()
+
+    if store != nil {
+        if err := store.SaveRoom(room); err != nil {
+            log.Printf("не удалось сохранить комнату %s в хранилище: %v", req.RoomID, err)
+        }
+    }
+
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(newRoomResponse(room))
+}
+
+// closeRoomHandler обрабатывает POST /rooms/{id}/close: только хост комнаты
+// может её закрыть. Закрытие проставляет EndedAt, выгоняет всех
+// присутствующих и уведомляет подписчиков события room_closed.
+func closeRoomHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+
+    roomID, rest, ok := parseRoomPath(r.URL.Path)
+    if !ok || rest != "close" {
+        http.NotFound(w, r)
+        return
+    }
+
+    caller := accountFromContext(r)
+
+    api.RoomLock.RLock()
+    room, exists := api.Rooms[roomID]
+    api.RoomLock.RUnlock()
+    if !exists {
+        http.Error(w, "Комната не найдена", http.StatusNotFound)
+        return
+    }
+
+    // Хостless-комнаты (созданные через /checkin, а не POST /rooms) закрыть
+    // может только admin — у них нет хоста, которому можно было бы это
+    // разрешить по имени.
+    isOwner := room.Host != nil && room.Host.Name == caller.Name
+    if !isOwner && !caller.Admin {
+        http.Error(w, "Закрыть комнату может только её хост", http.StatusForbidden)
+        return
+    }
+
+    room.UserLock.Lock()
+    room.Users = make(map[string]User)
+    room.UserLock.Unlock()
+
+    room.LifecycleLock.Lock()
+    room.EndedAt = time.Now()
+    room.LifecycleLock.Unlock()
+
+    if store != nil {
+        if err := store.SaveRoom(room); err != nil {
+            log.Printf("не удалось сохранить закрытие комнаты %s в хранилище: %v", roomID, err)
+        }
+    }
+
+    room.Hub.Publish(Event{Type: EventRoomClosed, RoomID: roomID})
+
+    fmt.Fprintf(w, "Комната %s закрыта\n", roomID)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    badger "github.com/dgraph-io/badger/v3"
+    _ "github.com/mattn/go-sqlite3"
+)
+
+// Store описывает бэкенд для хранения комнат и пользователей между перезапусками.
+type Store interface {
+    // SaveRoom сохраняет комнату целиком (используется при создании комнаты).
+    SaveRoom(room *Room) error
+    // LoadRooms возвращает все сохранённые комнаты для восстановления api.Rooms при старте.
+    LoadRooms() (map[string]*Room, error)
+    // UpsertUser создаёт или обновляет запись о пользователе в комнате.
+    UpsertUser(roomID string, user User) error
+    // DeleteExpiredUsers удаляет из хранилища всех пользователей с истёкшим ExpiresAt.
+    DeleteExpiredUsers(now time.Time) error
+    // Close освобождает ресурсы хранилища.
+    Close() error
+}
+
+// badgerStore хранит комнаты и пользователей во встраиваемой BadgerDB.
+type badgerStore struct {
+    db *badger.DB
+}
+
+// NewBadgerStore открывает (или создаёт) BadgerDB по указанному пути.
+func NewBadgerStore(path string) (Store, error) {
+    opts := badger.DefaultOptions(path)
+    db, err := badger.Open(opts)
+    if err != nil {
+        return nil, fmt.Errorf("не удалось открыть BadgerDB: %w", err)
+    }
+    return &badgerStore{db: db}, nil
+}
+
+func roomKey(roomID string) []byte {
+    return []byte("room:" + roomID)
+}
+
+func userKey(roomID, userID string) []byte {
+    return []byte("user:" + roomID + ":" + userID)
+}
+
+func (s *badgerStore) SaveRoom(room *Room) error {
+    snap := roomSnapshot{
+        Name:        room.Name,
+        CreatedAt:   room.CreatedAt,
+        ScheduledAt: room.ScheduledAt,
+        EndedAt:     room.EndedAt,
+    }
+    if room.Host != nil {
+        snap.HostName = room.Host.Name
+        snap.HostAdmin = room.Host.Admin
+    }
+
+    return s.db.Update(func(txn *badger.Txn) error {
+        data, err := json.Marshal(snap)
+        if err != nil {
+            return err
+        }
+        return txn.Set(roomKey(room.Name), data)
+    })
+}
+
+func (s *badgerStore) UpsertUser(roomID string, user User) error {
+    return s.db.Update(func(txn *badger.Txn) error {
+        data, err := json.Marshal(userRecord{RoomID: roomID, User: user})
+        if err != nil {
+            return err
+        }
+        return txn.Set(userKey(roomID, user.ID), data)
+    })
+}
+
+func (s *badgerStore) LoadRooms() (map[string]*Room, error) {
+    rooms := make(map[string]*Room)
+
+    err := s.db.View(func(txn *badger.Txn) error {
+        it := txn.NewIterator(badger.DefaultIteratorOptions)
+        defer it.Close()
+
+        for it.Seek([]byte("room:")); it.ValidForPrefix([]byte("room:")); it.Next() {
+            var snap roomSnapshot
+            if err := it.Item().Value(func(v []byte) error {
+                return json.Unmarshal(v, &snap)
+            }); err != nil {
+                return err
+            }
+            room := &Room{
+                Name:        snap.Name,
+                Users:       make(map[string]User),
+                CreatedAt:   snap.CreatedAt,
+                ScheduledAt: snap.ScheduledAt,
+                EndedAt:     snap.EndedAt,
+            }
+            if snap.HostName != "" {
+                room.Host = &Account{Name: snap.HostName, Admin: snap.HostAdmin}
+            }
+            rooms[snap.Name] = room
+        }
+
+        for it.Seek([]byte("user:")); it.ValidForPrefix([]byte("user:")); it.Next() {
+            var rec userRecord
+            if err := it.Item().Value(func(v []byte) error {
+                return json.Unmarshal(v, &rec)
+            }); err != nil {
+                return err
+            }
+            room, ok := rooms[rec.RoomID]
+            if !ok {
+                room = &Room{Name: rec.RoomID, Users: make(map[string]User)}
+                rooms[rec.RoomID] = room
+            }
+            room.Users[rec.User.ID] = rec.User
+        }
+
+        return nil
+    })
+
+    return rooms, err
+}
+
+func (s *badgerStore) DeleteExpiredUsers(now time.Time) error {
+    return s.db.Update(func(txn *badger.Txn) error {
+        it := txn.NewIterator(badger.DefaultIteratorOptions)
+        defer it.Close()
+
+        var stale [][]byte
+        for it.Seek([]byte("user:")); it.ValidForPrefix([]byte("user:")); it.Next() {
+            var rec userRecord
+            if err := it.Item().Value(func(v []byte) error {
+                return json.Unmarshal(v, &rec)
+            }); err != nil {
+                return err
+            }
+            if !rec.User.ExpiresAt.After(now) {
+                stale = append(stale, append([]byte(nil), it.Item().Key()...))
+            }
+        }
+
+        for _, key := range stale {
+            if err := txn.Delete(key); err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+func (s *badgerStore) Close() error {
+    return s.db.Close()
+}
+
+// roomSnapshot — то, что реально персистентно для комнаты (без мьютекса и
+// хаба). HostName пустой означает, что у комнаты нет хоста (например, она
+// была создана чек-ином, а не через POST /rooms).
+type roomSnapshot struct {
+    Name        string    `json:"name"`
+    HostName    string    `json:"host_name,omitempty"`
+    HostAdmin   bool      `json:"host_admin,omitempty"`
+    CreatedAt   time.Time `json:"created_at"`
+    ScheduledAt time.Time `json:"scheduled_at,omitempty"`
+    EndedAt     time.Time `json:"ended_at,omitempty"`
+}
+
+// userRecord связывает пользователя с его комнатой для плоского key-value хранилища.
+type userRecord struct {
+    RoomID string `json:"room_id"`
+    User   User   `json:"user"`
+}
+
+// sqlStore хранит комнаты и пользователей в SQLite через database/sql.
+// Postgres не поддерживается: добавить его можно, подключив реальный
+// драйвер (lib/pq, pgx и т.п.) и параметризовав driverName заново.
+type sqlStore struct {
+    db *sql.DB
+}
+
+// NewSQLStore открывает SQLite-базу по dataSourceName и создаёт схему при
+// первом запуске.
+func NewSQLStore(dataSourceName string) (Store, error) {
+    db, err := sql.Open("sqlite3", dataSourceName)
+    if err != nil {
+        return nil, fmt.Errorf("не удалось открыть БД: %w", err)
+    }
+    if err := db.Ping(); err != nil {
+        return nil, fmt.Errorf("не удалось подключиться к БД: %w", err)
+    }
+
+    s := &sqlStore{db: db}
+    if err := s.migrate(); err != nil {
+        db.Close()
+        return nil, err
+    }
+    return s, nil
+}
+
+func (s *sqlStore) migrate() error {
+    _, err := s.db.Exec(`
+        CREATE TABLE IF NOT EXISTS rooms (
+            name         TEXT PRIMARY KEY,
+            host_name    TEXT,
+            host_admin   BOOLEAN NOT NULL DEFAULT 0,
+            created_at   TIMESTAMP,
+            scheduled_at TIMESTAMP,
+            ended_at     TIMESTAMP
+        );
+        CREATE TABLE IF NOT EXISTS users (
+            room_name  TEXT NOT NULL,
+            user_id    TEXT NOT NULL,
+            expires_at TIMESTAMP NOT NULL,
+            PRIMARY KEY (room_name, user_id)
+        );
+    `)
+    return err
+}
+
+func (s *sqlStore) SaveRoom(room *Room) error {
+    var hostName sql.NullString
+    var hostAdmin bool
+    if room.Host != nil {
+        hostName = sql.NullString{String: room.Host.Name, Valid: true}
+        hostAdmin = room.Host.Admin
+    }
+    var scheduledAt, endedAt sql.NullTime
+    if !room.ScheduledAt.IsZero() {
+        scheduledAt = sql.NullTime{Time: room.ScheduledAt, Valid: true}
+    }
+    if !room.EndedAt.IsZero() {
+        endedAt = sql.NullTime{Time: room.EndedAt, Valid: true}
+    }
+
+    _, err := s.db.Exec(`
+        INSERT INTO rooms (name, host_name, host_admin, created_at, scheduled_at, ended_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT (name) DO UPDATE SET
+            host_name    = excluded.host_name,
+            host_admin   = excluded.host_admin,
+            created_at   = excluded.created_at,
+            scheduled_at = excluded.scheduled_at,
+            ended_at     = excluded.ended_at
+    `, room.Name, hostName, hostAdmin, room.CreatedAt, scheduledAt, endedAt)
+    return err
+}
+
+func (s *sqlStore) UpsertUser(roomID string, user User) error {
+    _, err := s.db.Exec(`
+        INSERT INTO users (room_name, user_id, expires_at) VALUES (?, ?, ?)
+        ON CONFLICT (room_name, user_id) DO UPDATE SET expires_at = excluded.expires_at
+    `, roomID, user.ID, user.ExpiresAt)
+    return err
+}
+
+func (s *sqlStore) LoadRooms() (map[string]*Room, error) {
+    rooms := make(map[string]*Room)
+
+    roomRows, err := s.db.Query(`SELECT name, host_name, host_admin, created_at, scheduled_at, ended_at FROM rooms`)
+    if err != nil {
+        return nil, err
+    }
+    defer roomRows.Close()
+
+    for roomRows.Next() {
+        var name string
+        var hostName sql.NullString
+        var hostAdmin bool
+        var createdAt time.Time
+        var scheduledAt, endedAt sql.NullTime
+        if err := roomRows.Scan(&name, &hostName, &hostAdmin, &createdAt, &scheduledAt, &endedAt); err != nil {
+            return nil, err
+        }
+
+        room := &Room{Name: name, Users: make(map[string]User), CreatedAt: createdAt}
+        if hostName.Valid {
+            room.Host = &Account{Name: hostName.String, Admin: hostAdmin}
+        }
+        if scheduledAt.Valid {
+            room.ScheduledAt = scheduledAt.Time
+        }
+        if endedAt.Valid {
+            room.EndedAt = endedAt.Time
+        }
+        rooms[name] = room
+    }
+
+    userRows, err := s.db.Query(`SELECT room_name, user_id, expires_at FROM users`)
+    if err != nil {
+        return nil, err
+    }
+    defer userRows.Close()
+
+    for userRows.Next() {
+        var roomName, userID string
+        var expiresAt time.Time
+        if err := userRows.Scan(&roomName, &userID, &expiresAt); err != nil {
+            return nil, err
+        }
+        room, ok := rooms[roomName]
+        if !ok {
+            room = &Room{Name: roomName, Users: make(map[string]User)}
+            rooms[roomName] = room
+        }
+        room.Users[userID] = User{ID: userID, ExpiresAt: expiresAt}
+    }
+
+    return rooms, nil
+}
+
+func (s *sqlStore) DeleteExpiredUsers(now time.Time) error {
+    _, err := s.db.Exec(`DELETE FROM users WHERE expires_at <= ?`, now)
+    return err
+}
+
+func (s *sqlStore) Close() error {
+    return s.db.Close()
+}